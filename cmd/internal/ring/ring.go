@@ -0,0 +1,54 @@
+// Package ring provides a small fixed-capacity byte-slice ring buffer
+// used to bound memory use while streaming records into a batch.
+package ring
+
+import "errors"
+
+// ErrFull is returned by Push when the buffer has reached capacity.
+var ErrFull = errors.New("ring: buffer is full")
+
+// Buffer is a fixed-capacity, non-concurrency-safe FIFO of byte
+// slices. Callers serialize access themselves.
+type Buffer struct {
+	items []([]byte)
+	head  int
+	size  int
+}
+
+// New returns a Buffer that holds at most capacity items.
+func New(capacity int) *Buffer {
+	return &Buffer{items: make([][]byte, capacity)}
+}
+
+// Push appends v to the buffer, returning ErrFull if it is at capacity.
+func (b *Buffer) Push(v []byte) error {
+	if b.size == len(b.items) {
+		return ErrFull
+	}
+	b.items[(b.head+b.size)%len(b.items)] = v
+	b.size++
+	return nil
+}
+
+// Pop removes and returns the oldest item. It returns false if the
+// buffer is empty.
+func (b *Buffer) Pop() ([]byte, bool) {
+	if b.size == 0 {
+		return nil, false
+	}
+	v := b.items[b.head]
+	b.items[b.head] = nil
+	b.head = (b.head + 1) % len(b.items)
+	b.size--
+	return v, true
+}
+
+// Len reports the number of items currently buffered.
+func (b *Buffer) Len() int {
+	return b.size
+}
+
+// Full reports whether the buffer is at capacity.
+func (b *Buffer) Full() bool {
+	return b.size == len(b.items)
+}
@@ -0,0 +1,61 @@
+package ring
+
+import "testing"
+
+func TestPushPop(t *testing.T) {
+	b := New(2)
+	if err := b.Push([]byte("a")); err != nil {
+		t.Fatalf("Push: %s", err)
+	}
+	if err := b.Push([]byte("b")); err != nil {
+		t.Fatalf("Push: %s", err)
+	}
+	if err := b.Push([]byte("c")); err != ErrFull {
+		t.Fatalf("Push on full buffer = %v, want ErrFull", err)
+	}
+
+	v, ok := b.Pop()
+	if !ok || string(v) != "a" {
+		t.Fatalf("Pop = %q, %v, want %q, true", v, ok, "a")
+	}
+	if err := b.Push([]byte("c")); err != nil {
+		t.Fatalf("Push after Pop: %s", err)
+	}
+
+	for _, want := range []string{"b", "c"} {
+		v, ok := b.Pop()
+		if !ok || string(v) != want {
+			t.Fatalf("Pop = %q, %v, want %q, true", v, ok, want)
+		}
+	}
+	if _, ok := b.Pop(); ok {
+		t.Fatal("Pop on empty buffer returned ok = true")
+	}
+}
+
+func TestFullAndLen(t *testing.T) {
+	b := New(3)
+	if b.Full() {
+		t.Fatal("new buffer reports Full")
+	}
+	for i := 0; i < 3; i++ {
+		_ = b.Push([]byte{byte(i)})
+	}
+	if !b.Full() {
+		t.Fatal("buffer at capacity does not report Full")
+	}
+	if b.Len() != 3 {
+		t.Fatalf("Len() = %d, want 3", b.Len())
+	}
+}
+
+func TestZeroCapacityAlwaysFull(t *testing.T) {
+	// New(0) is a degenerate buffer that can never hold anything;
+	// callers must reject a zero batch size before constructing one
+	// (see streamSend's -batch-size validation) rather than relying
+	// on Push to surface it.
+	b := New(0)
+	if err := b.Push([]byte("a")); err != ErrFull {
+		t.Fatalf("Push on zero-capacity buffer = %v, want ErrFull", err)
+	}
+}
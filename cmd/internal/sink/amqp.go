@@ -0,0 +1,59 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+type amqpSink struct {
+	client *amqp.Client
+	sess   *amqp.Session
+	sender *amqp.Sender
+}
+
+func newAMQP(u *url.URL) (Sink, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client, err := amqp.Dial(ctx, fmt.Sprintf("amqp://%s", u.Host), nil)
+	if err != nil {
+		return nil, fmt.Errorf("sink: dial amqp broker %s: %w", u.Host, err)
+	}
+	sess, err := client.NewSession(ctx, nil)
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("sink: open amqp session: %w", err)
+	}
+
+	node := strings.TrimPrefix(u.Path, "/")
+	if node == "" {
+		node = "iothub-device/events"
+	}
+	sender, err := sess.NewSender(ctx, node, nil)
+	if err != nil {
+		sess.Close(ctx)
+		client.Close()
+		return nil, fmt.Errorf("sink: open amqp sender: %w", err)
+	}
+
+	return &amqpSink{client: client, sess: sess, sender: sender}, nil
+}
+
+func (s *amqpSink) Send(b []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return s.sender.Send(ctx, amqp.NewMessage(b), nil)
+}
+
+func (s *amqpSink) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	s.sender.Close(ctx)
+	s.sess.Close(ctx)
+	return s.client.Close()
+}
@@ -0,0 +1,36 @@
+package sink
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+)
+
+type file struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func newFile(u *url.URL) (Sink, error) {
+	path := u.Path
+	if path == "" {
+		path = u.Opaque
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("sink: open %q: %w", path, err)
+	}
+	return &file{f: f}, nil
+}
+
+func (s *file) Send(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err := s.f.Write(append(b, '\n'))
+	return err
+}
+
+func (s *file) Close() error {
+	return s.f.Close()
+}
@@ -0,0 +1,41 @@
+package sink
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+type mqttSink struct {
+	client paho.Client
+	topic  string
+}
+
+func newMQTT(u *url.URL) (Sink, error) {
+	topic := strings.TrimPrefix(u.Path, "/")
+	if topic == "" {
+		topic = "iothub-device/events"
+	}
+
+	opts := paho.NewClientOptions().AddBroker(fmt.Sprintf("tcp://%s", u.Host))
+	client := paho.NewClient(opts)
+	if token := client.Connect(); !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		return nil, fmt.Errorf("sink: connect to mqtt broker %s: %w", u.Host, token.Error())
+	}
+
+	return &mqttSink{client: client, topic: topic}, nil
+}
+
+func (s *mqttSink) Send(b []byte) error {
+	token := s.client.Publish(s.topic, 1, false, b)
+	token.Wait()
+	return token.Error()
+}
+
+func (s *mqttSink) Close() error {
+	s.client.Disconnect(250)
+	return nil
+}
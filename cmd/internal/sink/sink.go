@@ -0,0 +1,47 @@
+// Package sink forwards CLI-received events (C2D messages, twin
+// updates, direct method invocations) to a configurable destination
+// instead of stdout, so iothub-device can act as a thin edge bridge.
+package sink
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Sink receives a single JSON-encodable event.
+type Sink interface {
+	// Send delivers b, the JSON encoding of the event, to the sink.
+	Send(b []byte) error
+
+	// Close releases any resources held by the sink.
+	Close() error
+}
+
+// New parses target and returns the matching Sink implementation.
+// Supported schemes are "stdout", "file", "http"/"https", "mqtt" and
+// "amqp"; an empty target defaults to stdout.
+func New(target string) (Sink, error) {
+	if target == "" || target == "stdout" {
+		return newStdout(), nil
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, fmt.Errorf("sink: parse %q: %w", target, err)
+	}
+
+	switch u.Scheme {
+	case "stdout":
+		return newStdout(), nil
+	case "file":
+		return newFile(u)
+	case "http", "https":
+		return newWebhook(u)
+	case "mqtt":
+		return newMQTT(u)
+	case "amqp":
+		return newAMQP(u)
+	default:
+		return nil, fmt.Errorf("sink: unsupported scheme %q", u.Scheme)
+	}
+}
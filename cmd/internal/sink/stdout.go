@@ -0,0 +1,21 @@
+package sink
+
+import (
+	"fmt"
+	"os"
+)
+
+type stdout struct{}
+
+func newStdout() Sink {
+	return stdout{}
+}
+
+func (stdout) Send(b []byte) error {
+	_, err := fmt.Fprintln(os.Stdout, string(b))
+	return err
+}
+
+func (stdout) Close() error {
+	return nil
+}
@@ -0,0 +1,37 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type webhook struct {
+	url    string
+	client *http.Client
+}
+
+func newWebhook(u *url.URL) (Sink, error) {
+	return &webhook{
+		url:    u.String(),
+		client: &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (s *webhook) Send(b []byte) error {
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("sink: post to %s: %w", s.url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sink: %s replied with status %d", s.url, resp.StatusCode)
+	}
+	return nil
+}
+
+func (s *webhook) Close() error {
+	return nil
+}
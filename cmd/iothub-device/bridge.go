@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/goautomotive/iothub/cmd/internal"
+	"github.com/goautomotive/iothub/iotdevice"
+)
+
+var (
+	localBrokerFlag         string
+	topicMapFlag            string
+	bridgeUpQoSFlag         int
+	bridgeDnQoSFlag         int
+	bridgeMethodsFlag       string
+	bridgeMethodTimeoutFlag time.Duration
+)
+
+// bridgeCommand registers the bridge subcommand, kept separate from
+// main's command table construction because of its own flag set and
+// because `wrap` already gives it a connected *iotdevice.Client.
+var bridgeCommand = &internal.Command{
+	"bridge", "br",
+	"",
+	"proxy a local MQTT broker to IoT Hub (up/# -> D2C, C2D/methods -> down/...)",
+	wrap(bridge),
+	func(f *flag.FlagSet) {
+		f.StringVar(&localBrokerFlag, "local-broker", "tcp://127.0.0.1:1883", "address of the local MQTT broker")
+		f.StringVar(&topicMapFlag, "topic-map", "", "comma separated old=new local topic rewrites, applied after the up/ or down/ prefix")
+		f.IntVar(&bridgeUpQoSFlag, "up-qos", 1, "QoS to subscribe local up/# topics with")
+		f.IntVar(&bridgeDnQoSFlag, "down-qos", 1, "QoS to publish local down/... topics with")
+		f.StringVar(&bridgeMethodsFlag, "methods", "", "comma separated direct method names to proxy to down/<method>, with the response read back from down/<method>/response")
+		f.DurationVar(&bridgeMethodTimeoutFlag, "method-timeout", 10*time.Second, "how long to wait for down/<method>/response before failing the method call")
+	},
+}
+
+// bridge connects to a local MQTT broker and shuttles messages between
+// it and IoT Hub for the lifetime of the process: local publishes on
+// up/<suffix> become D2C events carrying "topic-suffix": <suffix> as
+// a message property, and C2D messages / direct methods are
+// republished locally on down/message and down/<method-name>.
+func bridge(ctx context.Context, f *flag.FlagSet, c *iotdevice.Client) error {
+	if f.NArg() != 0 {
+		return internal.ErrInvalidUsage
+	}
+	rewrites, err := parseTopicMap(topicMapFlag)
+	if err != nil {
+		return err
+	}
+
+	opts := paho.NewClientOptions().AddBroker(localBrokerFlag).SetAutoReconnect(true)
+	local := paho.NewClient(opts)
+	if token := local.Connect(); !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		return fmt.Errorf("bridge: connect to local broker %s: %w", localBrokerFlag, token.Error())
+	}
+	defer local.Disconnect(250)
+
+	errc := make(chan error, 3)
+
+	token := local.Subscribe("up/#", byte(bridgeUpQoSFlag), func(_ paho.Client, m paho.Message) {
+		suffix := strings.TrimPrefix(m.Topic(), "up/")
+		suffix = rewrites.apply(suffix)
+		err := c.SendEvent(ctx, m.Payload(), iotdevice.WithSendProperties(map[string]string{
+			"topic-suffix": suffix,
+		}))
+		if err != nil {
+			errc <- fmt.Errorf("bridge: publish d2c event from %s: %w", m.Topic(), err)
+		}
+	})
+	if !token.WaitTimeout(10*time.Second) || token.Error() != nil {
+		return fmt.Errorf("bridge: subscribe up/#: %w", token.Error())
+	}
+
+	go func() {
+		sub, err := c.SubscribeEvents(ctx)
+		if err != nil {
+			errc <- fmt.Errorf("bridge: subscribe c2d: %w", err)
+			return
+		}
+		for msg := range sub.C() {
+			topic := "down/" + rewrites.apply("message")
+			tok := local.Publish(topic, byte(bridgeDnQoSFlag), false, msg.Payload)
+			tok.Wait()
+		}
+		if err := sub.Err(); err != nil {
+			errc <- fmt.Errorf("bridge: c2d subscription ended: %w", err)
+		}
+	}()
+
+	for _, name := range splitNonEmpty(bridgeMethodsFlag, ",") {
+		name := name
+		err := c.RegisterMethod(ctx, name, methodBridgeHandler(local, rewrites.apply(name), bridgeDnQoSFlag, bridgeMethodTimeoutFlag))
+		if err != nil {
+			return fmt.Errorf("bridge: register direct method %q: %w", name, err)
+		}
+	}
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// topicRewrites applies `old=new` pairs parsed from -topic-map.
+type topicRewrites map[string]string
+
+func parseTopicMap(s string) (topicRewrites, error) {
+	m := topicRewrites{}
+	if s == "" {
+		return m, nil
+	}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("bridge: invalid -topic-map entry %q, want old=new", pair)
+		}
+		m[kv[0]] = kv[1]
+	}
+	return m, nil
+}
+
+func (m topicRewrites) apply(suffix string) string {
+	if v, ok := m[suffix]; ok {
+		return v
+	}
+	return suffix
+}
+
+func splitNonEmpty(s, sep string) []string {
+	if s == "" {
+		return nil
+	}
+	var out []string
+	for _, part := range strings.Split(s, sep) {
+		if part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// methodBridgeHandler publishes a direct method's payload to
+// down/<name> and waits up to timeout for a reply on
+// down/<name>/response, so a local MQTT service can answer direct
+// methods without ever talking to IoT Hub directly.
+func methodBridgeHandler(local paho.Client, name string, qos int, timeout time.Duration) func(map[string]interface{}) (map[string]interface{}, error) {
+	responseTopic := fmt.Sprintf("down/%s/response", name)
+	return func(p map[string]interface{}) (map[string]interface{}, error) {
+		b, err := json.Marshal(p)
+		if err != nil {
+			return nil, fmt.Errorf("bridge: marshal method payload: %w", err)
+		}
+
+		replyc := make(chan []byte, 1)
+		token := local.Subscribe(responseTopic, byte(qos), func(_ paho.Client, m paho.Message) {
+			select {
+			case replyc <- m.Payload():
+			default:
+			}
+		})
+		if !token.WaitTimeout(timeout) || token.Error() != nil {
+			return nil, fmt.Errorf("bridge: subscribe %s: %w", responseTopic, token.Error())
+		}
+		defer local.Unsubscribe(responseTopic)
+
+		pub := local.Publish(fmt.Sprintf("down/%s", name), byte(qos), false, b)
+		if !pub.WaitTimeout(timeout) {
+			return nil, fmt.Errorf("bridge: publish down/%s timed out", name)
+		}
+		if err := pub.Error(); err != nil {
+			return nil, fmt.Errorf("bridge: publish down/%s: %w", name, err)
+		}
+
+		select {
+		case reply := <-replyc:
+			var v map[string]interface{}
+			if err := json.Unmarshal(reply, &v); err != nil {
+				return nil, fmt.Errorf("bridge: unmarshal %s response: %w", responseTopic, err)
+			}
+			return v, nil
+		case <-time.After(timeout):
+			return nil, fmt.Errorf("bridge: no response on %s within %s", responseTopic, timeout)
+		}
+	}
+}
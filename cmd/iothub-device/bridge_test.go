@@ -0,0 +1,64 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseTopicMap(t *testing.T) {
+	cases := []struct {
+		name    string
+		in      string
+		want    topicRewrites
+		wantErr bool
+	}{
+		{"empty", "", topicRewrites{}, false},
+		{"single", "a=b", topicRewrites{"a": "b"}, false},
+		{"multiple", "a=b,c=d", topicRewrites{"a": "b", "c": "d"}, false},
+		{"missing equals", "a", nil, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := parseTopicMap(c.in)
+			if c.wantErr {
+				if err == nil {
+					t.Fatalf("parseTopicMap(%q) = nil error, want error", c.in)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseTopicMap(%q) unexpected error: %s", c.in, err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("parseTopicMap(%q) = %v, want %v", c.in, got, c.want)
+			}
+		})
+	}
+}
+
+func TestTopicRewritesApply(t *testing.T) {
+	m := topicRewrites{"a": "b"}
+	if got := m.apply("a"); got != "b" {
+		t.Errorf("apply(a) = %q, want %q", got, "b")
+	}
+	if got := m.apply("c"); got != "c" {
+		t.Errorf("apply(c) = %q, want unchanged %q", got, "c")
+	}
+}
+
+func TestSplitNonEmpty(t *testing.T) {
+	cases := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a", []string{"a"}},
+		{"a,b,c", []string{"a", "b", "c"}},
+		{"a,,b", []string{"a", "b"}},
+	}
+	for _, c := range cases {
+		if got := splitNonEmpty(c.in, ","); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("splitNonEmpty(%q) = %v, want %v", c.in, got, c.want)
+		}
+	}
+}
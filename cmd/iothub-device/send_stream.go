@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/goautomotive/iothub/cmd/internal/ring"
+	"github.com/goautomotive/iothub/iotdevice"
+)
+
+// onErrorAction is what streamSend does with a batch that could not
+// be sent after retries are exhausted.
+type onErrorAction string
+
+const (
+	onErrorDrop       onErrorAction = "drop"
+	onErrorHalt       onErrorAction = "halt"
+	onErrorDeadLetter onErrorAction = "dead-letter-file"
+)
+
+// streamOptions configures streamSend; it is assembled from the
+// -batch-size, -batch-interval, -framing, -max-inflight, -retry and
+// -on-error flags of the send subcommand.
+type streamOptions struct {
+	framing       string // "lines" or "length"
+	batchSize     int
+	batchInterval time.Duration
+	maxInflight   int
+	retry         int
+	onError       onErrorAction
+	deadLetter    string
+	ttl           time.Duration
+}
+
+// streamSend reads records from r, coalescing up to opts.batchSize of
+// them or opts.batchInterval of wall time (whichever comes first)
+// into a single SendEventBatch call. Up to opts.maxInflight batches may be
+// publishing concurrently; once that many are outstanding, reading
+// further records from r blocks, giving natural backpressure on a
+// slow or disconnected hub.
+func streamSend(ctx context.Context, c *iotdevice.Client, r io.Reader, opts streamOptions) error {
+	if opts.batchSize < 1 {
+		return fmt.Errorf("-batch-size must be >= 1, got %d", opts.batchSize)
+	}
+
+	records := make(chan []byte)
+	readErrc := make(chan error, 1)
+	go func() {
+		readErrc <- readRecords(r, opts.framing, records)
+	}()
+
+	var dead *os.File
+	if opts.onError == onErrorDeadLetter {
+		f, err := os.OpenFile(opts.deadLetter, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open dead-letter file: %w", err)
+		}
+		defer f.Close()
+		dead = f
+	}
+
+	sem := make(chan struct{}, opts.maxInflight)
+	var wg sync.WaitGroup
+	var haltErr error
+	var haltOnce sync.Once
+	haltCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	submit := func(batch [][]byte) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			err := sendWithRetry(haltCtx, c, batch, opts.retry, opts.ttl)
+			if err == nil {
+				return
+			}
+			switch opts.onError {
+			case onErrorHalt:
+				haltOnce.Do(func() {
+					haltErr = err
+					cancel()
+				})
+			case onErrorDeadLetter:
+				if werr := writeDeadLetter(dead, batch, err); werr != nil {
+					haltOnce.Do(func() {
+						haltErr = werr
+						cancel()
+					})
+				}
+			default: // drop
+			}
+		}()
+	}
+
+	buf := ring.New(opts.batchSize)
+	drain := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		batch := make([][]byte, 0, buf.Len())
+		for {
+			rec, ok := buf.Pop()
+			if !ok {
+				break
+			}
+			batch = append(batch, rec)
+		}
+		submit(batch)
+	}
+
+	ticker := time.NewTicker(opts.batchInterval)
+	defer ticker.Stop()
+
+loop:
+	for {
+		select {
+		case rec, ok := <-records:
+			if !ok {
+				break loop
+			}
+			if err := buf.Push(rec); err == ring.ErrFull {
+				drain()
+				_ = buf.Push(rec)
+			}
+			if buf.Full() {
+				drain()
+			}
+		case <-ticker.C:
+			drain()
+		case <-haltCtx.Done():
+			break loop
+		}
+	}
+
+	if haltCtx.Err() == nil {
+		drain()
+	}
+	wg.Wait()
+
+	if haltErr != nil {
+		return haltErr
+	}
+	if err := <-readErrc; err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+func readRecords(r io.Reader, framing string, out chan<- []byte) error {
+	defer close(out)
+	if framing == "length" {
+		return readLengthPrefixed(r, out)
+	}
+	return readNDJSON(r, out)
+}
+
+func readNDJSON(r io.Reader, out chan<- []byte) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := sc.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+		rec := make([]byte, len(line))
+		copy(rec, line)
+		out <- rec
+	}
+	return sc.Err()
+}
+
+func readLengthPrefixed(r io.Reader, out chan<- []byte) error {
+	br := bufio.NewReader(r)
+	for {
+		var n uint32
+		if err := binary.Read(br, binary.BigEndian, &n); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("read frame length: %w", err)
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return fmt.Errorf("read frame: %w", err)
+		}
+		out <- buf
+	}
+}
+
+// sendWithRetry publishes batch, retrying up to maxRetries times with
+// exponential backoff and jitter on failure. ttl is forwarded as
+// iotdevice.WithSendTTL, so a batch that ends up queued in the
+// offline outbox (see -outbox) expires after ttl instead of being
+// held forever.
+func sendWithRetry(ctx context.Context, c *iotdevice.Client, batch [][]byte, maxRetries int, ttl time.Duration) error {
+	var err error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			backoff := time.Duration(1<<uint(attempt-1)) * 100 * time.Millisecond
+			jitter := time.Duration(rand.Int63n(int64(backoff)/2 + 1))
+			select {
+			case <-time.After(backoff + jitter):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if len(batch) == 1 {
+			err = c.SendEvent(ctx, batch[0], iotdevice.WithSendTTL(ttl))
+		} else {
+			err = c.SendEventBatch(ctx, batch, iotdevice.WithSendTTL(ttl))
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("send batch of %d after %d retries: %w", len(batch), maxRetries, err)
+}
+
+func writeDeadLetter(f *os.File, batch [][]byte, cause error) error {
+	for _, rec := range batch {
+		if _, err := fmt.Fprintf(f, "%s\n", rec); err != nil {
+			return fmt.Errorf("write dead-letter record: %w", err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "on-error=dead-letter-file: %d record(s) written after: %s\n", len(batch), cause)
+	return nil
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestStreamSendRejectsInvalidBatchSize(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		err := streamSend(context.Background(), nil, strings.NewReader(""), streamOptions{batchSize: size})
+		if err == nil {
+			t.Errorf("streamSend with batch-size=%d: expected error, got nil", size)
+		}
+	}
+}
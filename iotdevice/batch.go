@@ -0,0 +1,43 @@
+package iotdevice
+
+import (
+	"context"
+	"fmt"
+)
+
+// SendEventBatch publishes a batch of D2C messages. Transports that
+// understand batching (such as amqp) take the whole batch in a single
+// call and send the payloads back to back over one link; others fall
+// back to sending each payload in order through SendEvent, so
+// callers can always use this API regardless of the active transport.
+func (c *Client) SendEventBatch(ctx context.Context, payloads [][]byte, opts ...SendOption) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+
+	if b, ok := c.tr.(batchPublisher); ok {
+		o := &sendOptions{properties: map[string]string{}}
+		for _, opt := range opts {
+			opt(o)
+		}
+		if err := b.PublishEventBatch(ctx, payloads, o.properties, o.messageID, o.correlationID); err != nil {
+			return fmt.Errorf("iotdevice: send event batch: %w", err)
+		}
+		return nil
+	}
+
+	for _, p := range payloads {
+		if err := c.SendEvent(ctx, p, opts...); err != nil {
+			return fmt.Errorf("iotdevice: send event batch: %w", err)
+		}
+	}
+	return nil
+}
+
+// batchPublisher is implemented by transports that can coalesce
+// multiple D2C payloads into a single publish operation. messageID and
+// correlationID, when non-empty, are applied to every message in the
+// batch.
+type batchPublisher interface {
+	PublishEventBatch(ctx context.Context, payloads [][]byte, props map[string]string, messageID, correlationID string) error
+}
@@ -0,0 +1,68 @@
+package iotdevice
+
+import (
+	"context"
+	"testing"
+
+	"github.com/goautomotive/iothub/common"
+	"github.com/goautomotive/iothub/iotdevice/transport"
+)
+
+// fakeBatchTransport implements transport.Transport (trivially, most
+// methods are unused by this test) plus batchPublisher, so it can
+// stand in for c.tr when exercising SendEventBatch's batching path.
+type fakeBatchTransport struct {
+	gotPayloads      [][]byte
+	gotProps         map[string]string
+	gotMessageID     string
+	gotCorrelationID string
+}
+
+func (f *fakeBatchTransport) Connect(ctx context.Context, creds transport.Credentials) error {
+	return nil
+}
+func (f *fakeBatchTransport) PublishEvent(ctx context.Context, msg *common.Message) error { return nil }
+func (f *fakeBatchTransport) SubscribeEvents(ctx context.Context, mc chan<- *common.Message) error {
+	return nil
+}
+func (f *fakeBatchTransport) RetrieveTwinProperties(ctx context.Context) ([]byte, error) {
+	return nil, nil
+}
+func (f *fakeBatchTransport) UpdateTwinProperties(ctx context.Context, payload []byte) (int, error) {
+	return 0, nil
+}
+func (f *fakeBatchTransport) RegisterDirectMethods(ctx context.Context, mux transport.MethodDispatcher) error {
+	return nil
+}
+func (f *fakeBatchTransport) Close() error { return nil }
+
+func (f *fakeBatchTransport) PublishEventBatch(ctx context.Context, payloads [][]byte, props map[string]string, messageID, correlationID string) error {
+	f.gotPayloads = payloads
+	f.gotProps = props
+	f.gotMessageID = messageID
+	f.gotCorrelationID = correlationID
+	return nil
+}
+
+func TestSendEventBatchAppliesAllOptions(t *testing.T) {
+	tr := &fakeBatchTransport{}
+	c := &Client{client: &client{tr: tr}}
+
+	err := c.SendEventBatch(context.Background(), [][]byte{[]byte("a"), []byte("b")},
+		WithSendProperties(map[string]string{"k1": "v1"}),
+		WithSendMessageID("mid"),
+		WithSendCorrelationID("cid"),
+	)
+	if err != nil {
+		t.Fatalf("SendEventBatch: %s", err)
+	}
+	if tr.gotProps["k1"] != "v1" {
+		t.Errorf("properties not applied: got %v", tr.gotProps)
+	}
+	if tr.gotMessageID != "mid" {
+		t.Errorf("messageID = %q, want %q", tr.gotMessageID, "mid")
+	}
+	if tr.gotCorrelationID != "cid" {
+		t.Errorf("correlationID = %q, want %q", tr.gotCorrelationID, "cid")
+	}
+}
@@ -0,0 +1,485 @@
+// Package iotdevice is a device-side IoT Hub client. It drives a
+// pluggable transport.Transport to send telemetry, receive C2D
+// messages, read/write the device twin and answer direct methods.
+package iotdevice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goautomotive/iothub/common"
+	"github.com/goautomotive/iothub/iotdevice/transport"
+	"github.com/goautomotive/iothub/outbox"
+)
+
+// ClientOption configures a Client before it connects.
+type ClientOption func(*client) error
+
+// client holds the state ClientOptions assemble; Client embeds it so
+// the option-driven setup code below and the runtime methods in
+// batch.go, outbox_option.go etc. can all share the same fields.
+type client struct {
+	tr     transport.Transport
+	logger *common.LogWrapper
+	outbox outbox.Store
+
+	deviceID string
+	hostname string
+	tls      *tls.Config
+
+	sasKeyName string
+	sasKey     []byte // decoded shared access key, nil for x509 auth
+
+	methodsMu         sync.Mutex
+	methods           map[string]func(map[string]interface{}) (map[string]interface{}, error)
+	methodsRegistered bool
+}
+
+// Client is an IoT Hub device client assembled by NewClient.
+type Client struct {
+	*client
+}
+
+// WithLogger sets the logger used for connection diagnostics.
+func WithLogger(l *common.LogWrapper) ClientOption {
+	return func(c *client) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// WithTransport selects the transport.Transport implementation used
+// to talk to IoT Hub, e.g. amqp.New() or mqtt.New().
+func WithTransport(tr transport.Transport) ClientOption {
+	return func(c *client) error {
+		c.tr = tr
+		return nil
+	}
+}
+
+// WithConnectionString authenticates with a device connection string
+// of the form "HostName=...;DeviceId=...;SharedAccessKey=...", minting
+// SAS tokens on demand from the shared access key.
+func WithConnectionString(cs string) ClientOption {
+	return func(c *client) error {
+		hostname, deviceID, keyName, key, err := parseConnectionString(cs)
+		if err != nil {
+			return err
+		}
+		c.hostname = hostname
+		c.deviceID = deviceID
+		c.sasKeyName = keyName
+		c.sasKey = key
+		return nil
+	}
+}
+
+// WithX509FromFile authenticates with an x509 certificate and private
+// key loaded from PEM files on disk.
+func WithX509FromFile(deviceID, hostname, certFile, keyFile string) ClientOption {
+	return func(c *client) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("iotdevice: load x509 key pair: %w", err)
+		}
+		c.deviceID = deviceID
+		c.hostname = hostname
+		c.tls = &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			ServerName:   hostname,
+		}
+		return nil
+	}
+}
+
+// NewClient assembles a Client from opts. The transport is not dialed
+// until Connect is called.
+func NewClient(opts ...ClientOption) (*Client, error) {
+	c := &client{
+		logger: common.NewLogWrapper(false),
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.tr == nil {
+		return nil, errors.New("iotdevice: no transport configured, use WithTransport")
+	}
+	return &Client{client: c}, nil
+}
+
+// Connect dials the configured transport and, if an outbox store was
+// set via WithOutboxStore, starts the background worker that drains
+// it once the connection is up.
+func (c *Client) Connect(ctx context.Context) error {
+	creds := transport.Credentials{
+		DeviceID:  c.deviceID,
+		Hostname:  c.hostname,
+		TLS:       c.tls,
+		TokenFunc: c.sasTokenFunc(),
+	}
+	if err := c.tr.Connect(ctx, creds); err != nil {
+		return fmt.Errorf("iotdevice: connect: %w", err)
+	}
+	if c.outbox != nil {
+		c.startOutboxWorker(ctx)
+	}
+	return nil
+}
+
+// sasTokenFunc returns the TokenFunc passed to the transport, or nil
+// when authenticating with an x509 certificate rather than a shared
+// access key.
+func (c *client) sasTokenFunc() func(ctx context.Context, audience string, ttl time.Duration) (string, error) {
+	if c.sasKey == nil {
+		return nil
+	}
+	return func(ctx context.Context, audience string, ttl time.Duration) (string, error) {
+		return sasToken(audience, c.sasKeyName, c.sasKey, ttl)
+	}
+}
+
+// sendOptions is built up by SendOptions before SendEvent/SendEventBatch
+// read fields off it.
+type sendOptions struct {
+	properties    map[string]string
+	messageID     string
+	correlationID string
+	qos           int
+	ttl           time.Duration
+}
+
+// SendOption configures a single SendEvent or SendEventBatch call.
+type SendOption func(*sendOptions)
+
+// WithSendProperties attaches application properties to the message.
+func WithSendProperties(props map[string]string) SendOption {
+	return func(o *sendOptions) {
+		for k, v := range props {
+			if o.properties == nil {
+				o.properties = make(map[string]string, len(props))
+			}
+			o.properties[k] = v
+		}
+	}
+}
+
+// WithSendMessageID sets the message's MessageID property.
+func WithSendMessageID(id string) SendOption {
+	return func(o *sendOptions) {
+		o.messageID = id
+	}
+}
+
+// WithSendCorrelationID sets the message's CorrelationID property.
+func WithSendCorrelationID(id string) SendOption {
+	return func(o *sendOptions) {
+		o.correlationID = id
+	}
+}
+
+// WithSendQoS records qos on the send options. SendEvent and
+// SendEventBatch do not pass it on to the transport, so it has no
+// effect on how the message is published.
+func WithSendQoS(qos int) SendOption {
+	return func(o *sendOptions) {
+		o.qos = qos
+	}
+}
+
+// WithSendTTL sets how long a message may sit in the offline outbox
+// (see WithOutboxStore) before it is dropped as stale instead of
+// being sent. It has no effect when no outbox store is configured, or
+// when the transport is connected and the send never needs queuing.
+func WithSendTTL(ttl time.Duration) SendOption {
+	return func(o *sendOptions) {
+		o.ttl = ttl
+	}
+}
+
+// SendEvent publishes a single D2C telemetry message. If the
+// transport reports the connection is down and an outbox store is
+// configured (WithOutboxStore), the message is queued for the
+// background drain worker instead of failing the call.
+func (c *Client) SendEvent(ctx context.Context, payload []byte, opts ...SendOption) error {
+	o := &sendOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	msg := &common.Message{
+		Payload:       payload,
+		Properties:    o.properties,
+		MessageID:     o.messageID,
+		CorrelationID: o.correlationID,
+	}
+
+	err := c.tr.PublishEvent(ctx, msg)
+	if err == nil {
+		return nil
+	}
+	if c.outbox != nil && errors.Is(err, transport.ErrDisconnected) {
+		if qerr := c.enqueueOnDisconnect(ctx, msg, o.ttl); qerr != nil {
+			return fmt.Errorf("iotdevice: send event: %w (outbox enqueue also failed: %s)", err, qerr)
+		}
+		return nil
+	}
+	return fmt.Errorf("iotdevice: send event: %w", err)
+}
+
+// EventSubscription streams C2D messages delivered to SubscribeEvents
+// until ctx is done.
+type EventSubscription struct {
+	c   chan *common.Message
+	err error
+}
+
+// C returns the channel C2D messages are delivered on. It is closed
+// once the subscription ends; check Err afterwards.
+func (s *EventSubscription) C() <-chan *common.Message { return s.c }
+
+// Err returns the reason the subscription ended, which is ctx.Err()
+// once ctx is done, or nil if it hasn't ended yet.
+func (s *EventSubscription) Err() error { return s.err }
+
+// SubscribeEvents streams C2D messages sent to the device until ctx is
+// done.
+func (c *Client) SubscribeEvents(ctx context.Context) (*EventSubscription, error) {
+	raw := make(chan *common.Message)
+	if err := c.tr.SubscribeEvents(ctx, raw); err != nil {
+		return nil, fmt.Errorf("iotdevice: subscribe events: %w", err)
+	}
+
+	sub := &EventSubscription{c: make(chan *common.Message)}
+	go func() {
+		defer close(sub.c)
+		for {
+			select {
+			case <-ctx.Done():
+				sub.err = ctx.Err()
+				return
+			case msg := <-raw:
+				select {
+				case sub.c <- msg:
+				case <-ctx.Done():
+					sub.err = ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// TwinState is a device twin property bag. A nil value passed to
+// UpdateTwinState deletes that key.
+type TwinState map[string]interface{}
+
+// RetrieveTwinState fetches the device twin's desired and reported
+// property sets.
+func (c *Client) RetrieveTwinState(ctx context.Context) (desired, reported TwinState, err error) {
+	b, err := c.tr.RetrieveTwinProperties(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("iotdevice: retrieve twin state: %w", err)
+	}
+	var doc struct {
+		Desired  TwinState `json:"desired"`
+		Reported TwinState `json:"reported"`
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, nil, fmt.Errorf("iotdevice: parse twin state: %w", err)
+	}
+	return doc.Desired, doc.Reported, nil
+}
+
+// UpdateTwinState patches the device twin's reported properties and
+// returns the resulting version.
+func (c *Client) UpdateTwinState(ctx context.Context, state TwinState) (int, error) {
+	payload, err := json.Marshal(state)
+	if err != nil {
+		return 0, fmt.Errorf("iotdevice: marshal twin state: %w", err)
+	}
+	version, err := c.tr.UpdateTwinProperties(ctx, payload)
+	if err != nil {
+		return 0, fmt.Errorf("iotdevice: update twin state: %w", err)
+	}
+	return version, nil
+}
+
+// twinPollInterval is how often SubscribeTwinUpdates re-fetches the
+// twin document to notice a new desired version. The AMQP twin link
+// only answers request/reply round trips; IoT Hub does not push
+// unsolicited desired-property updates over it, so this polls instead
+// of subscribing in the strict sense.
+const twinPollInterval = 10 * time.Second
+
+// TwinSubscription streams the desired twin document each time its
+// version changes, until ctx is done.
+type TwinSubscription struct {
+	c   chan TwinState
+	err error
+}
+
+// C returns the channel desired twin states are delivered on. It is
+// closed once the subscription ends; check Err afterwards.
+func (s *TwinSubscription) C() <-chan TwinState { return s.c }
+
+// Err returns the reason the subscription ended: ctx.Err() once ctx
+// is done, or the error that made a twin fetch fail. It is nil if the
+// subscription hasn't ended yet.
+func (s *TwinSubscription) Err() error { return s.err }
+
+// SubscribeTwinUpdates polls the desired twin properties and delivers
+// the desired document whenever its "$version" changes, until ctx is
+// done.
+func (c *Client) SubscribeTwinUpdates(ctx context.Context) (*TwinSubscription, error) {
+	sub := &TwinSubscription{c: make(chan TwinState)}
+	go func() {
+		defer close(sub.c)
+		ticker := time.NewTicker(twinPollInterval)
+		defer ticker.Stop()
+
+		var lastVersion float64
+		seen := false
+		for {
+			select {
+			case <-ctx.Done():
+				sub.err = ctx.Err()
+				return
+			case <-ticker.C:
+				desired, _, err := c.RetrieveTwinState(ctx)
+				if err != nil {
+					sub.err = err
+					return
+				}
+				version, _ := desired["$version"].(float64)
+				if seen && version == lastVersion {
+					continue
+				}
+				seen = true
+				lastVersion = version
+				select {
+				case sub.c <- desired:
+				case <-ctx.Done():
+					sub.err = ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+	return sub, nil
+}
+
+// RegisterMethod installs handler as the implementation of the named
+// direct method. It may be called more than once to register several
+// methods; the transport is told about the dispatcher only once.
+func (c *Client) RegisterMethod(ctx context.Context, name string, handler func(map[string]interface{}) (map[string]interface{}, error)) error {
+	c.methodsMu.Lock()
+	if c.methods == nil {
+		c.methods = make(map[string]func(map[string]interface{}) (map[string]interface{}, error))
+	}
+	c.methods[name] = handler
+	alreadyRegistered := c.methodsRegistered
+	c.methodsRegistered = true
+	c.methodsMu.Unlock()
+
+	if alreadyRegistered {
+		return nil
+	}
+	if err := c.tr.RegisterDirectMethods(ctx, c.dispatchMethod); err != nil {
+		return fmt.Errorf("iotdevice: register method %q: %w", name, err)
+	}
+	return nil
+}
+
+// dispatchMethod is the single transport.MethodDispatcher registered
+// with the transport; it looks the call up by name in c.methods.
+func (c *client) dispatchMethod(ctx context.Context, name string, payload []byte) ([]byte, int) {
+	c.methodsMu.Lock()
+	handler := c.methods[name]
+	c.methodsMu.Unlock()
+	if handler == nil {
+		return []byte(fmt.Sprintf(`{"error":%q}`, fmt.Sprintf("method %q not registered", name))), 404
+	}
+
+	var p map[string]interface{}
+	if len(payload) > 0 {
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return []byte(fmt.Sprintf(`{"error":%q}`, err.Error())), 400
+		}
+	}
+
+	resp, err := handler(p)
+	if err != nil {
+		return []byte(fmt.Sprintf(`{"error":%q}`, err.Error())), 500
+	}
+	b, err := json.Marshal(resp)
+	if err != nil {
+		return []byte(fmt.Sprintf(`{"error":%q}`, err.Error())), 500
+	}
+	return b, 200
+}
+
+// parseConnectionString extracts the fields iothub-device needs from
+// a device connection string of the form
+// "HostName=h;DeviceId=d;SharedAccessKey=k" or, with a shared access
+// policy, "...;SharedAccessKeyName=n;SharedAccessKey=k".
+func parseConnectionString(cs string) (hostname, deviceID, keyName string, key []byte, err error) {
+	for _, pair := range strings.Split(cs, ";") {
+		if pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return "", "", "", nil, fmt.Errorf("iotdevice: invalid connection string segment %q", pair)
+		}
+		switch kv[0] {
+		case "HostName":
+			hostname = kv[1]
+		case "DeviceId":
+			deviceID = kv[1]
+		case "SharedAccessKeyName":
+			keyName = kv[1]
+		case "SharedAccessKey":
+			key, err = base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				return "", "", "", nil, fmt.Errorf("iotdevice: decode SharedAccessKey: %w", err)
+			}
+		}
+	}
+	if hostname == "" || deviceID == "" || key == nil {
+		return "", "", "", nil, errors.New("iotdevice: connection string must set HostName, DeviceId and SharedAccessKey")
+	}
+	return hostname, deviceID, keyName, key, nil
+}
+
+// sasToken mints a SAS token of the form IoT Hub's CBS node and REST
+// APIs both accept: "SharedAccessSignature sr=<resource>&sig=<hmac>&se=<expiry>[&skn=<keyName>]".
+func sasToken(resource, keyName string, key []byte, ttl time.Duration) (string, error) {
+	expiry := time.Now().Add(ttl).Unix()
+	encodedResource := url.QueryEscape(resource)
+	toSign := fmt.Sprintf("%s\n%d", encodedResource, expiry)
+
+	mac := hmac.New(sha256.New, key)
+	if _, err := mac.Write([]byte(toSign)); err != nil {
+		return "", fmt.Errorf("iotdevice: sign sas token: %w", err)
+	}
+	sig := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	token := fmt.Sprintf("SharedAccessSignature sr=%s&sig=%s&se=%d", encodedResource, url.QueryEscape(sig), expiry)
+	if keyName != "" {
+		token += "&skn=" + url.QueryEscape(keyName)
+	}
+	return token, nil
+}
@@ -0,0 +1,174 @@
+package iotdevice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/goautomotive/iothub/common"
+	"github.com/goautomotive/iothub/iotdevice/transport"
+	"github.com/goautomotive/iothub/outbox"
+)
+
+// fakeTransport is a stub transport.Transport used to exercise Client
+// without a real network connection.
+type fakeTransport struct {
+	publishErr error
+
+	twinDoc    []byte
+	twinErr    error
+	updatedVer int
+	updateErr  error
+
+	dispatch transport.MethodDispatcher
+}
+
+func (f *fakeTransport) Connect(ctx context.Context, creds transport.Credentials) error { return nil }
+func (f *fakeTransport) PublishEvent(ctx context.Context, msg *common.Message) error {
+	return f.publishErr
+}
+func (f *fakeTransport) SubscribeEvents(ctx context.Context, mc chan<- *common.Message) error {
+	return nil
+}
+func (f *fakeTransport) RetrieveTwinProperties(ctx context.Context) ([]byte, error) {
+	return f.twinDoc, f.twinErr
+}
+func (f *fakeTransport) UpdateTwinProperties(ctx context.Context, payload []byte) (int, error) {
+	return f.updatedVer, f.updateErr
+}
+func (f *fakeTransport) RegisterDirectMethods(ctx context.Context, mux transport.MethodDispatcher) error {
+	f.dispatch = mux
+	return nil
+}
+func (f *fakeTransport) Close() error { return nil }
+
+// fakeStore is an in-memory outbox.Store that keeps every enqueued
+// envelope in a slice, oldest first.
+type fakeStore struct {
+	queue []outbox.Envelope
+}
+
+func (s *fakeStore) Enqueue(ctx context.Context, e outbox.Envelope) error {
+	s.queue = append(s.queue, e)
+	return nil
+}
+func (s *fakeStore) Peek(ctx context.Context) (outbox.Envelope, error) {
+	if len(s.queue) == 0 {
+		return outbox.Envelope{}, outbox.ErrEmpty
+	}
+	return s.queue[0], nil
+}
+func (s *fakeStore) Ack(ctx context.Context) error {
+	if len(s.queue) == 0 {
+		return outbox.ErrEmpty
+	}
+	s.queue = s.queue[1:]
+	return nil
+}
+func (s *fakeStore) Len(ctx context.Context) (int, error) { return len(s.queue), nil }
+func (s *fakeStore) Close() error                         { return nil }
+
+func TestSendEventPropagatesTransportError(t *testing.T) {
+	tr := &fakeTransport{publishErr: errors.New("boom")}
+	c := &Client{client: &client{tr: tr}}
+
+	if err := c.SendEvent(context.Background(), []byte("payload")); err == nil {
+		t.Fatal("SendEvent: expected error, got nil")
+	}
+}
+
+func TestSendEventEnqueuesOnDisconnect(t *testing.T) {
+	tr := &fakeTransport{publishErr: fmt.Errorf("amqp: publish event: %w", transport.ErrDisconnected)}
+	store := &fakeStore{}
+	c := &Client{client: &client{tr: tr, outbox: store}}
+
+	err := c.SendEvent(context.Background(), []byte("payload"), WithSendTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("SendEvent: %s", err)
+	}
+	if len(store.queue) != 1 {
+		t.Fatalf("outbox has %d envelopes, want 1", len(store.queue))
+	}
+	if store.queue[0].TTL != time.Minute {
+		t.Errorf("envelope TTL = %s, want %s", store.queue[0].TTL, time.Minute)
+	}
+}
+
+func TestSendEventPropagatesNonDisconnectError(t *testing.T) {
+	tr := &fakeTransport{publishErr: errors.New("boom")}
+	store := &fakeStore{}
+	c := &Client{client: &client{tr: tr, outbox: store}}
+
+	if err := c.SendEvent(context.Background(), []byte("payload")); err == nil {
+		t.Fatal("SendEvent: expected error, got nil")
+	}
+	if len(store.queue) != 0 {
+		t.Fatalf("outbox has %d envelopes, want 0 for a non-disconnect error", len(store.queue))
+	}
+}
+
+func TestRetrieveTwinState(t *testing.T) {
+	doc, _ := json.Marshal(map[string]interface{}{
+		"desired":  map[string]interface{}{"$version": 2, "fanSpeed": "high"},
+		"reported": map[string]interface{}{"$version": 1},
+	})
+	tr := &fakeTransport{twinDoc: doc}
+	c := &Client{client: &client{tr: tr}}
+
+	desired, reported, err := c.RetrieveTwinState(context.Background())
+	if err != nil {
+		t.Fatalf("RetrieveTwinState: %s", err)
+	}
+	if desired["fanSpeed"] != "high" {
+		t.Errorf("desired[fanSpeed] = %v, want %q", desired["fanSpeed"], "high")
+	}
+	if _, ok := reported["$version"]; !ok {
+		t.Errorf("reported missing $version: %v", reported)
+	}
+}
+
+func TestUpdateTwinState(t *testing.T) {
+	tr := &fakeTransport{updatedVer: 3}
+	c := &Client{client: &client{tr: tr}}
+
+	ver, err := c.UpdateTwinState(context.Background(), TwinState{"fanSpeed": "low"})
+	if err != nil {
+		t.Fatalf("UpdateTwinState: %s", err)
+	}
+	if ver != 3 {
+		t.Errorf("version = %d, want 3", ver)
+	}
+}
+
+func TestRegisterMethodDispatchesByName(t *testing.T) {
+	tr := &fakeTransport{}
+	c := &Client{client: &client{tr: tr}}
+
+	var got map[string]interface{}
+	err := c.RegisterMethod(context.Background(), "reboot", func(p map[string]interface{}) (map[string]interface{}, error) {
+		got = p
+		return map[string]interface{}{"ok": true}, nil
+	})
+	if err != nil {
+		t.Fatalf("RegisterMethod: %s", err)
+	}
+	if tr.dispatch == nil {
+		t.Fatal("RegisterMethod did not register a dispatcher with the transport")
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{"delay": 5})
+	resp, status := tr.dispatch(context.Background(), "reboot", payload)
+	if status != 200 {
+		t.Fatalf("status = %d, want 200, body %s", status, resp)
+	}
+	if got["delay"] != float64(5) {
+		t.Errorf("handler got %v, want delay=5", got)
+	}
+
+	if _, status := tr.dispatch(context.Background(), "unknown", nil); status != 404 {
+		t.Errorf("unknown method status = %d, want 404", status)
+	}
+}
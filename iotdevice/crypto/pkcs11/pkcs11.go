@@ -0,0 +1,150 @@
+// Package pkcs11 resolves "pkcs11:" URIs (RFC 7512) to a crypto.Signer
+// backed by a PKCS#11 token, so an x509 device's private key can live
+// in an HSM instead of a PEM file.
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/pkcs11"
+
+	iotcrypto "github.com/goautomotive/iothub/iotdevice/crypto"
+)
+
+func init() {
+	iotcrypto.Register(provider{})
+}
+
+type provider struct{}
+
+func (provider) Scheme() string { return "pkcs11" }
+
+// uriAttrs are the RFC 7512 "pkcs11-path" attributes this provider
+// understands. Anything else is ignored.
+type uriAttrs struct {
+	module string
+	token  string
+	label  string
+	id     string
+	slot   int
+	pin    string
+}
+
+// Resolve looks up the private key at keyURI and, for the
+// certificate, either parses certURI if given or, when certURI is
+// empty, falls back to the key's own label/id on the same token —
+// which is enough to find the matching CKO_CERTIFICATE object on
+// tokens that store both under the same identifier (common with
+// tokens provisioned by, e.g., pkcs11-tool).
+func (provider) Resolve(certURI, keyURI string) (crypto.Signer, *x509.Certificate, error) {
+	keyAttrs, err := parseURI(keyURI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("pkcs11: parse key uri: %w", err)
+	}
+
+	ctx := pkcs11.New(keyAttrs.module)
+	if ctx == nil {
+		return nil, nil, fmt.Errorf("pkcs11: unable to load module %q", keyAttrs.module)
+	}
+	if err := ctx.Initialize(); err != nil {
+		return nil, nil, fmt.Errorf("pkcs11: initialize: %w", err)
+	}
+
+	session, err := openSession(ctx, keyAttrs)
+	if err != nil {
+		ctx.Destroy()
+		return nil, nil, err
+	}
+
+	signer := &signer{ctx: ctx, session: session, label: keyAttrs.label, id: keyAttrs.id}
+	if err := signer.findKey(); err != nil {
+		ctx.CloseSession(session)
+		ctx.Destroy()
+		return nil, nil, err
+	}
+
+	certAttrs := keyAttrs
+	if certURI != "" {
+		certAttrs, err = parseURI(certURI)
+		if err != nil {
+			ctx.CloseSession(session)
+			ctx.Destroy()
+			return nil, nil, fmt.Errorf("pkcs11: parse cert uri: %w", err)
+		}
+	}
+	cert, err := findCertificate(ctx, session, certAttrs)
+	if err != nil {
+		if certURI != "" {
+			ctx.CloseSession(session)
+			ctx.Destroy()
+			return nil, nil, err
+		}
+		// No --tls-cert-uri was given and the key's own label/id
+		// didn't match a certificate object either; the caller
+		// decides whether that's fatal.
+		cert = nil
+	}
+	if cert != nil {
+		signer.pub = cert.PublicKey
+	}
+
+	return signer, cert, nil
+}
+
+func openSession(ctx *pkcs11.Ctx, a *uriAttrs) (pkcs11.SessionHandle, error) {
+	session, err := ctx.OpenSession(uint(a.slot), pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return 0, fmt.Errorf("pkcs11: open session: %w", err)
+	}
+	if a.pin != "" {
+		if err := ctx.Login(session, pkcs11.CKU_USER, a.pin); err != nil {
+			return 0, fmt.Errorf("pkcs11: login: %w", err)
+		}
+	}
+	return session, nil
+}
+
+// parseURI decodes the subset of RFC 7512 that iothub-device cares
+// about: token, object (label) and id as ";"-separated path
+// attributes, and module-path, pin-value and slot-id as query
+// parameters, e.g. "pkcs11:token=t;object=o?module-path=/lib/p11.so".
+func parseURI(raw string) (*uriAttrs, error) {
+	if !strings.HasPrefix(raw, "pkcs11:") {
+		return nil, fmt.Errorf("not a pkcs11 uri: %q", raw)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := &uriAttrs{}
+	for _, pair := range strings.Split(strings.TrimPrefix(u.Opaque+u.Path, ""), ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "token":
+			attrs.token = kv[1]
+		case "object":
+			attrs.label = kv[1]
+		case "id":
+			attrs.id = kv[1]
+		}
+	}
+	q := u.Query()
+	attrs.module = q.Get("module-path")
+	attrs.pin = q.Get("pin-value")
+	if s := q.Get("slot-id"); s != "" {
+		attrs.slot, _ = strconv.Atoi(s)
+	}
+	if attrs.module == "" {
+		return nil, fmt.Errorf("pkcs11 uri %q is missing module-path", raw)
+	}
+	return attrs, nil
+}
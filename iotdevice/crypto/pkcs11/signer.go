@@ -0,0 +1,170 @@
+package pkcs11
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/miekg/pkcs11"
+)
+
+// signer implements crypto.Signer against a private key object that
+// stays on the token; Sign issues a C_Sign call rather than exporting
+// key material.
+type signer struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	label   string
+	id      string
+
+	handle  pkcs11.ObjectHandle
+	keyType uint // CKK_RSA, CKK_EC, ... read from CKA_KEY_TYPE by findKey
+	pub     crypto.PublicKey
+}
+
+func (s *signer) findKey() error {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_PRIVATE_KEY),
+	}
+	if s.label != "" {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_LABEL, s.label))
+	}
+	if s.id != "" {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(s.id)))
+	}
+
+	if err := s.ctx.FindObjectsInit(s.session, tmpl); err != nil {
+		return fmt.Errorf("pkcs11: find objects init: %w", err)
+	}
+	defer s.ctx.FindObjectsFinal(s.session)
+
+	handles, _, err := s.ctx.FindObjects(s.session, 1)
+	if err != nil {
+		return fmt.Errorf("pkcs11: find objects: %w", err)
+	}
+	if len(handles) == 0 {
+		return fmt.Errorf("pkcs11: no private key matching label=%q id=%q", s.label, s.id)
+	}
+	s.handle = handles[0]
+
+	attrs, err := s.ctx.GetAttributeValue(s.session, s.handle, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil),
+	})
+	if err != nil {
+		return fmt.Errorf("pkcs11: read key type: %w", err)
+	}
+	s.keyType = ulongFromBytes(attrs[0].Value)
+	return nil
+}
+
+// ulongFromBytes decodes a CK_ULONG-valued attribute, which PKCS#11
+// modules hand back as either 4 or 8 little-endian bytes depending on
+// the platform's native unsigned long width.
+func ulongFromBytes(b []byte) uint {
+	switch len(b) {
+	case 4:
+		return uint(binary.LittleEndian.Uint32(b))
+	case 8:
+		return uint(binary.LittleEndian.Uint64(b))
+	default:
+		return 0
+	}
+}
+
+// Public returns the public key of the certificate Resolve found for
+// this key, or nil when no certificate was found. crypto/tls reads it
+// to pick a signature scheme for the client certificate.
+func (s *signer) Public() crypto.PublicKey {
+	return s.pub
+}
+
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	mechType := signMechanism(s.keyType)
+	mech := []*pkcs11.Mechanism{pkcs11.NewMechanism(mechType, nil)}
+	if err := s.ctx.SignInit(s.session, mech, s.handle); err != nil {
+		return nil, fmt.Errorf("pkcs11: sign init: %w", err)
+	}
+
+	in := digest
+	if mechType == pkcs11.CKM_RSA_PKCS {
+		prefix, ok := hashPrefixes[opts.HashFunc()]
+		if !ok {
+			return nil, fmt.Errorf("pkcs11: unsupported hash %v for RSA PKCS#1 v1.5 signing", opts.HashFunc())
+		}
+		in = append(prefix, digest...)
+	}
+
+	sig, err := s.ctx.Sign(s.session, in)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: sign: %w", err)
+	}
+	return sig, nil
+}
+
+// hashPrefixes holds the DER-encoded DigestInfo prefix (ASN.1
+// SEQUENCE{SEQUENCE{hash OID, NULL}, OCTET STRING}, up to but not
+// including the digest itself) for each hash algorithm this package
+// supports signing with CKM_RSA_PKCS, mirroring the table
+// crypto/rsa.SignPKCS1v15 uses internally. CKM_RSA_PKCS takes this
+// DigestInfo as input rather than the bare hash, unlike CKM_ECDSA.
+var hashPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA1: {0x30, 0x21, 0x30, 0x09, 0x06, 0x05, 0x2b, 0x0e, 0x03, 0x02, 0x1a, 0x05, 0x00, 0x04, 0x14},
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02,
+		0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02,
+		0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02,
+		0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// signMechanism picks the PKCS#11 signing mechanism for keyType, as
+// read from the private key's CKA_KEY_TYPE attribute by findKey. It
+// cannot be derived from the crypto.SignerOpts passed to Sign: for
+// both RSA and ECDSA keys the stdlib and this package's callers pass
+// a plain crypto.Hash value, which is indistinguishable between key
+// types at that layer.
+func signMechanism(keyType uint) uint {
+	if keyType == pkcs11.CKK_EC {
+		return pkcs11.CKM_ECDSA
+	}
+	return pkcs11.CKM_RSA_PKCS
+}
+
+func findCertificate(ctx *pkcs11.Ctx, session pkcs11.SessionHandle, a *uriAttrs) (*x509.Certificate, error) {
+	tmpl := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, pkcs11.CKO_CERTIFICATE),
+	}
+	if a.label != "" {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_LABEL, a.label))
+	}
+	if a.id != "" {
+		tmpl = append(tmpl, pkcs11.NewAttribute(pkcs11.CKA_ID, []byte(a.id)))
+	}
+
+	if err := ctx.FindObjectsInit(session, tmpl); err != nil {
+		return nil, fmt.Errorf("pkcs11: find cert init: %w", err)
+	}
+	defer ctx.FindObjectsFinal(session)
+
+	handles, _, err := ctx.FindObjects(session, 1)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: find cert: %w", err)
+	}
+	if len(handles) == 0 {
+		return nil, fmt.Errorf("pkcs11: no certificate matching label=%q id=%q", a.label, a.id)
+	}
+
+	attrs, err := ctx.GetAttributeValue(session, handles[0], []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_VALUE, nil),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: read cert value: %w", err)
+	}
+	cert, err := x509.ParseCertificate(attrs[0].Value)
+	if err != nil {
+		return nil, fmt.Errorf("pkcs11: parse cert: %w", err)
+	}
+	return cert, nil
+}
@@ -0,0 +1,68 @@
+package pkcs11
+
+import (
+	"crypto"
+	"testing"
+
+	"github.com/miekg/pkcs11"
+)
+
+func TestSignMechanism(t *testing.T) {
+	cases := []struct {
+		keyType uint
+		want    uint
+	}{
+		{pkcs11.CKK_EC, pkcs11.CKM_ECDSA},
+		{pkcs11.CKK_RSA, pkcs11.CKM_RSA_PKCS},
+		{0, pkcs11.CKM_RSA_PKCS},
+	}
+	for _, c := range cases {
+		if got := signMechanism(c.keyType); got != c.want {
+			t.Errorf("signMechanism(%d) = %d, want %d", c.keyType, got, c.want)
+		}
+	}
+}
+
+func TestHashPrefixesMatchDigestInfoLength(t *testing.T) {
+	// crypto.Hash.Size() is the raw digest length; DigestInfo total
+	// length is encoded in the outer SEQUENCE's length byte (prefix[1])
+	// plus the 2-byte tag+length header, so prefix[1]+2 should equal
+	// len(prefix)+Size().
+	cases := []struct {
+		hash crypto.Hash
+		size int
+	}{
+		{crypto.SHA1, 20},
+		{crypto.SHA256, 32},
+		{crypto.SHA384, 48},
+		{crypto.SHA512, 64},
+	}
+	for _, c := range cases {
+		prefix, ok := hashPrefixes[c.hash]
+		if !ok {
+			t.Fatalf("hashPrefixes missing entry for %v", c.hash)
+		}
+		if got, want := int(prefix[1])+2, len(prefix)+c.size; got != want {
+			t.Errorf("%v: DigestInfo total length = %d, want %d", c.hash, got, want)
+		}
+	}
+}
+
+func TestUlongFromBytes(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []byte
+		want uint
+	}{
+		{"4-byte", []byte{0x03, 0x00, 0x00, 0x00}, 3},
+		{"8-byte", []byte{0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}, 3},
+		{"unexpected length", []byte{0x01, 0x02}, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := ulongFromBytes(c.in); got != c.want {
+				t.Errorf("ulongFromBytes(%v) = %d, want %d", c.in, got, c.want)
+			}
+		})
+	}
+}
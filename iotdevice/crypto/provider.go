@@ -0,0 +1,47 @@
+// Package crypto lets x509 device credentials be backed by something
+// other than a PEM file on disk, such as a PKCS#11 token or a TPM,
+// identified by a provider-specific URI (RFC 7512 for PKCS#11).
+package crypto
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"sync"
+)
+
+// Provider resolves a URI into a signer and the certificate it
+// corresponds to. The private key backing the signer never has to
+// leave the device.
+type Provider interface {
+	// Scheme is the URI scheme this provider handles, e.g. "pkcs11".
+	Scheme() string
+
+	// Resolve returns a signer for keyURI and, when certURI is
+	// non-empty, the certificate stored at certURI.
+	Resolve(certURI, keyURI string) (crypto.Signer, *x509.Certificate, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]Provider{}
+)
+
+// Register adds p to the provider registry, keyed by p.Scheme().
+// It is typically called from an init function of a provider package.
+func Register(p Provider) {
+	mu.Lock()
+	defer mu.Unlock()
+	providers[p.Scheme()] = p
+}
+
+// Lookup returns the provider registered for scheme, if any.
+func Lookup(scheme string) (Provider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	p, ok := providers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("crypto: no provider registered for scheme %q", scheme)
+	}
+	return p, nil
+}
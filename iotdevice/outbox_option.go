@@ -0,0 +1,108 @@
+package iotdevice
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/goautomotive/iothub/common"
+	"github.com/goautomotive/iothub/outbox"
+)
+
+// errNoOutbox is returned by enqueueOnDisconnect when no outbox store
+// was configured via WithOutboxStore.
+var errNoOutbox = errors.New("iotdevice: no outbox store configured")
+
+// outboxDrainInterval is how often the background worker retries the
+// head of the queue while the transport is disconnected.
+const outboxDrainInterval = 5 * time.Second
+
+// WithOutboxStore makes SendEvent durable across disconnects: once
+// the transport reports the connection is down, SendEvent enqueues to
+// store instead of failing, and a background worker drains the queue
+// in order as soon as the connection is back, skipping any envelope
+// whose TTL has elapsed.
+func WithOutboxStore(store outbox.Store) ClientOption {
+	return func(c *client) error {
+		c.outbox = store
+		return nil
+	}
+}
+
+// startOutboxWorker is called once from Connect when an outbox store
+// is configured. It runs until ctx is done.
+func (c *client) startOutboxWorker(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(outboxDrainInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.drainOutbox(ctx)
+			}
+		}
+	}()
+}
+
+func (c *client) drainOutbox(ctx context.Context) {
+	for {
+		e, err := c.outbox.Peek(ctx)
+		if err == outbox.ErrEmpty {
+			return
+		}
+		if err != nil {
+			c.logger.Errorf("iotdevice: outbox peek: %s", err)
+			return
+		}
+
+		if e.Expired(time.Now()) {
+			if err := c.outbox.Ack(ctx); err != nil {
+				c.logger.Errorf("iotdevice: outbox ack expired envelope: %s", err)
+			}
+			continue
+		}
+
+		if err := c.sendEventDirect(ctx, e); err != nil {
+			// leave it queued, the transport is presumably still down
+			return
+		}
+		if err := c.outbox.Ack(ctx); err != nil {
+			c.logger.Errorf("iotdevice: outbox ack: %s", err)
+			return
+		}
+	}
+}
+
+// enqueueOnDisconnect is called by SendEvent when publishing through
+// the transport fails with a disconnection error and an outbox store
+// is configured; it takes ownership of the send by queuing it instead
+// of returning the error to the caller. ttl, as set by WithSendTTL,
+// becomes the envelope's expiry; zero means the envelope never
+// expires.
+func (c *client) enqueueOnDisconnect(ctx context.Context, msg *common.Message, ttl time.Duration) error {
+	if c.outbox == nil {
+		return errNoOutbox
+	}
+	return c.outbox.Enqueue(ctx, outbox.Envelope{
+		Payload:       msg.Payload,
+		Properties:    msg.Properties,
+		MessageID:     msg.MessageID,
+		CorrelationID: msg.CorrelationID,
+		EnqueuedAt:    time.Now(),
+		TTL:           ttl,
+	})
+}
+
+// sendEventDirect publishes an outbox envelope straight through the
+// transport, bypassing the enqueue-on-disconnect path in SendEvent so
+// the drain worker doesn't re-queue what it just dequeued.
+func (c *client) sendEventDirect(ctx context.Context, e outbox.Envelope) error {
+	return c.tr.PublishEvent(ctx, &common.Message{
+		Payload:       e.Payload,
+		Properties:    e.Properties,
+		MessageID:     e.MessageID,
+		CorrelationID: e.CorrelationID,
+	})
+}
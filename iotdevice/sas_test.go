@@ -0,0 +1,37 @@
+package iotdevice
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConnectionString(t *testing.T) {
+	cs := "HostName=myhub.azure-devices.net;DeviceId=dev1;SharedAccessKey=c2VjcmV0"
+	hostname, deviceID, keyName, key, err := parseConnectionString(cs)
+	if err != nil {
+		t.Fatalf("parseConnectionString: %s", err)
+	}
+	if hostname != "myhub.azure-devices.net" || deviceID != "dev1" || keyName != "" || string(key) != "secret" {
+		t.Fatalf("got (%q, %q, %q, %q)", hostname, deviceID, keyName, key)
+	}
+}
+
+func TestParseConnectionStringMissingField(t *testing.T) {
+	if _, _, _, _, err := parseConnectionString("HostName=h;DeviceId=d"); err == nil {
+		t.Fatal("expected error for connection string missing SharedAccessKey")
+	}
+}
+
+func TestSASToken(t *testing.T) {
+	token, err := sasToken("myhub.azure-devices.net/devices/dev1", "", []byte("secret"), time.Hour)
+	if err != nil {
+		t.Fatalf("sasToken: %s", err)
+	}
+	if !strings.HasPrefix(token, "SharedAccessSignature sr=") {
+		t.Fatalf("token doesn't look like a SAS token: %s", token)
+	}
+	if !strings.Contains(token, "&sig=") || !strings.Contains(token, "&se=") {
+		t.Fatalf("token missing expected fields: %s", token)
+	}
+}
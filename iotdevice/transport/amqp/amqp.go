@@ -0,0 +1,268 @@
+// Package amqp implements the iotdevice transport.Transport interface
+// on top of AMQP 1.0, matching the link topology used by the other
+// IoT Hub device SDKs (D2C/C2D, twin and direct-method links, plus
+// CBS-based SAS token renewal).
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/go-amqp"
+
+	"github.com/goautomotive/iothub/common"
+	"github.com/goautomotive/iothub/iotdevice/transport"
+)
+
+const (
+	d2cLinkFmt     = "/devices/%s/messages/events"
+	c2dLinkFmt     = "/devices/%s/messages/devicebound"
+	twinSendLink   = "$iothub/twin"
+	twinRecvFmt    = "twin-recv-%d"
+	methodsLink    = "$iothub/methods/devicebound"
+	methodsReply   = "$iothub/methods/res"
+	cbsNodeAddr    = "$cbs"
+	cbsAudienceFmt = "%s/devices/%s"
+
+	defaultTokenTTL  = time.Hour
+	tokenRenewBefore = 5 * time.Minute
+)
+
+// Option configures a Transport before it is connected.
+type Option func(tr *Transport)
+
+// WithLogger sets the logger used for connection and link diagnostics.
+func WithLogger(l *common.LogWrapper) Option {
+	return func(tr *Transport) {
+		tr.logger = l
+	}
+}
+
+// Transport is an AMQP 1.0 implementation of transport.Transport.
+type Transport struct {
+	logger *common.LogWrapper
+
+	mu      sync.Mutex
+	creds   transport.Credentials
+	client  *amqp.Client
+	session *amqp.Session
+
+	d2cSender   *amqp.Sender
+	c2dReceiver *amqp.Receiver
+
+	twinSender   *amqp.Sender
+	twinReceiver *amqp.Receiver
+	twinCorr     sync.Map // map[string]chan twinResponse
+
+	methodReceiver *amqp.Receiver
+	methodSender   *amqp.Sender
+	methodMu       sync.Mutex
+	dispatch       transport.MethodDispatcher
+
+	closed int32
+	done   chan struct{}
+}
+
+// New creates an unconnected AMQP transport.
+func New(opts ...Option) (transport.Transport, error) {
+	tr := &Transport{
+		logger: common.NewLogWrapper(false),
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(tr)
+	}
+	return tr, nil
+}
+
+// Connect dials IoT Hub over TLS, puts a SAS token on the CBS node
+// when creds.TokenFunc is set, and opens the D2C, C2D, twin and
+// direct-method links.
+func (tr *Transport) Connect(ctx context.Context, creds transport.Credentials) error {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	tr.creds = creds
+
+	client, err := amqp.Dial(ctx, "amqps://"+creds.Hostname, &amqp.ConnOptions{
+		TLSConfig: creds.TLS,
+		SASLType:  amqp.SASLTypeAnonymous(),
+	})
+	if err != nil {
+		return fmt.Errorf("amqp: dial: %w", err)
+	}
+	tr.client = client
+
+	session, err := client.NewSession(ctx, nil)
+	if err != nil {
+		client.Close()
+		return fmt.Errorf("amqp: new session: %w", err)
+	}
+	tr.session = session
+
+	if err := tr.negotiateCBS(ctx); err != nil {
+		session.Close(ctx)
+		client.Close()
+		return err
+	}
+
+	if err := tr.openLinks(ctx); err != nil {
+		session.Close(ctx)
+		client.Close()
+		return err
+	}
+
+	go tr.refreshTokenLoop()
+
+	return nil
+}
+
+func (tr *Transport) openLinks(ctx context.Context) error {
+	d2c, err := tr.session.NewSender(ctx, fmt.Sprintf(d2cLinkFmt, tr.creds.DeviceID), nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open d2c sender: %w", err)
+	}
+	tr.d2cSender = d2c
+
+	c2d, err := tr.session.NewReceiver(ctx, fmt.Sprintf(c2dLinkFmt, tr.creds.DeviceID), nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open c2d receiver: %w", err)
+	}
+	tr.c2dReceiver = c2d
+
+	twinSnd, err := tr.session.NewSender(ctx, twinSendLink, nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open twin sender: %w", err)
+	}
+	tr.twinSender = twinSnd
+
+	twinRcv, err := tr.session.NewReceiver(ctx, fmt.Sprintf(twinRecvFmt, time.Now().UnixNano()), nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open twin receiver: %w", err)
+	}
+	tr.twinReceiver = twinRcv
+	go tr.dispatchTwinResponses()
+
+	methRcv, err := tr.session.NewReceiver(ctx, methodsLink, nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open methods receiver: %w", err)
+	}
+	tr.methodReceiver = methRcv
+
+	methSnd, err := tr.session.NewSender(ctx, methodsReply, nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open methods sender: %w", err)
+	}
+	tr.methodSender = methSnd
+	go tr.dispatchMethods()
+
+	return nil
+}
+
+// PublishEvent sends a single D2C telemetry message.
+func (tr *Transport) PublishEvent(ctx context.Context, msg *common.Message) error {
+	tr.mu.Lock()
+	sender := tr.d2cSender
+	tr.mu.Unlock()
+	if sender == nil {
+		return fmt.Errorf("amqp: publish event: %w", transport.ErrDisconnected)
+	}
+
+	m := &amqp.Message{
+		Data: [][]byte{msg.Payload},
+		Properties: &amqp.MessageProperties{
+			MessageID:     msg.MessageID,
+			CorrelationID: msg.CorrelationID,
+		},
+		ApplicationProperties: make(map[string]interface{}, len(msg.Properties)),
+	}
+	for k, v := range msg.Properties {
+		m.ApplicationProperties[k] = v
+	}
+	if err := sender.Send(ctx, m, nil); err != nil {
+		return fmt.Errorf("amqp: publish event: %w", err)
+	}
+	return nil
+}
+
+// SubscribeEvents streams C2D messages onto mc until ctx is done or
+// the transport is closed.
+func (tr *Transport) SubscribeEvents(ctx context.Context, mc chan<- *common.Message) error {
+	tr.mu.Lock()
+	receiver := tr.c2dReceiver
+	tr.mu.Unlock()
+	if receiver == nil {
+		return fmt.Errorf("amqp: subscribe events: %w", transport.ErrDisconnected)
+	}
+
+	go func() {
+		for {
+			m, err := receiver.Receive(ctx, nil)
+			if err != nil {
+				return
+			}
+			props := make(map[string]string, len(m.ApplicationProperties))
+			for k, v := range m.ApplicationProperties {
+				if s, ok := v.(string); ok {
+					props[k] = s
+				}
+			}
+			var payload []byte
+			if len(m.Data) > 0 {
+				payload = m.Data[0]
+			}
+			mc <- &common.Message{
+				Payload:    payload,
+				Properties: props,
+			}
+			receiver.AcceptMessage(ctx, m)
+		}
+	}()
+	return nil
+}
+
+// RegisterDirectMethods installs mux as the dispatcher for incoming
+// direct method calls delivered on the methods link.
+func (tr *Transport) RegisterDirectMethods(ctx context.Context, mux transport.MethodDispatcher) error {
+	tr.methodMu.Lock()
+	defer tr.methodMu.Unlock()
+	tr.dispatch = mux
+	return nil
+}
+
+func (tr *Transport) refreshTokenLoop() {
+	ttl := defaultTokenTTL
+	timer := time.NewTimer(ttl - tokenRenewBefore)
+	defer timer.Stop()
+	for {
+		select {
+		case <-tr.done:
+			return
+		case <-timer.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			err := tr.negotiateCBS(ctx)
+			cancel()
+			if err != nil {
+				tr.logger.Errorf("amqp: token refresh failed: %s", err)
+			}
+			timer.Reset(ttl - tokenRenewBefore)
+		}
+	}
+}
+
+// Close tears down all links and the underlying connection.
+func (tr *Transport) Close() error {
+	if !atomic.CompareAndSwapInt32(&tr.closed, 0, 1) {
+		return nil
+	}
+	close(tr.done)
+
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if tr.client == nil {
+		return nil
+	}
+	return tr.client.Close()
+}
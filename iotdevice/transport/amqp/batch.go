@@ -0,0 +1,45 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/go-amqp"
+
+	"github.com/goautomotive/iothub/iotdevice/transport"
+)
+
+// PublishEventBatch sends payloads as separate AMQP transfers over the
+// same D2C link without waiting for each disposition before issuing
+// the next send, which is what "batching" means at the AMQP 1.0
+// link level (there is no multi-body envelope in the protocol).
+// messageID and correlationID, when non-empty, are set on every
+// message in the batch.
+func (tr *Transport) PublishEventBatch(ctx context.Context, payloads [][]byte, props map[string]string, messageID, correlationID string) error {
+	tr.mu.Lock()
+	sender := tr.d2cSender
+	tr.mu.Unlock()
+	if sender == nil {
+		return fmt.Errorf("amqp: publish event batch: %w", transport.ErrDisconnected)
+	}
+
+	appProps := make(map[string]interface{}, len(props))
+	for k, v := range props {
+		appProps[k] = v
+	}
+
+	for _, payload := range payloads {
+		m := &amqp.Message{
+			Data: [][]byte{payload},
+			Properties: &amqp.MessageProperties{
+				MessageID:     messageID,
+				CorrelationID: correlationID,
+			},
+			ApplicationProperties: appProps,
+		}
+		if err := sender.Send(ctx, m, nil); err != nil {
+			return fmt.Errorf("amqp: publish event batch: %w", err)
+		}
+	}
+	return nil
+}
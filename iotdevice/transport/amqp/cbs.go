@@ -0,0 +1,73 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+// negotiateCBS puts a fresh SAS token on the well known $cbs node,
+// following the claims-based-security exchange IoT Hub expects before
+// any other link can be attached. It does nothing when the
+// credentials carry no TokenFunc (x509 authentication).
+func (tr *Transport) negotiateCBS(ctx context.Context) error {
+	if tr.creds.TokenFunc == nil {
+		return nil
+	}
+	audience := fmt.Sprintf(cbsAudienceFmt, tr.creds.Hostname, tr.creds.DeviceID)
+	token, err := tr.creds.TokenFunc(ctx, audience, defaultTokenTTL)
+	if err != nil {
+		return fmt.Errorf("amqp: mint cbs token: %w", err)
+	}
+
+	sender, err := tr.session.NewSender(ctx, cbsNodeAddr, nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open cbs sender: %w", err)
+	}
+	defer sender.Close(ctx)
+
+	receiver, err := tr.session.NewReceiver(ctx, cbsNodeAddr, nil)
+	if err != nil {
+		return fmt.Errorf("amqp: open cbs receiver: %w", err)
+	}
+	defer receiver.Close(ctx)
+
+	replyTo := fmt.Sprintf("cbs-reply-%d", time.Now().UnixNano())
+	msg := &amqp.Message{
+		Data: [][]byte{[]byte(token)},
+		Properties: &amqp.MessageProperties{
+			MessageID: replyTo,
+			ReplyTo:   replyTo,
+		},
+		ApplicationProperties: map[string]interface{}{
+			"operation": "put-token",
+			"type":      "servicebus.windows.net:sastoken",
+			"name":      audience,
+		},
+	}
+	if err := sender.Send(ctx, msg, nil); err != nil {
+		return fmt.Errorf("amqp: send cbs token: %w", err)
+	}
+
+	reply, err := receiver.Receive(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("amqp: cbs reply: %w", err)
+	}
+	receiver.AcceptMessage(ctx, reply)
+
+	code, _ := reply.ApplicationProperties["status-code"].(int32)
+	if !isCBSSuccess(code) {
+		return fmt.Errorf("amqp: cbs rejected token, status %d", code)
+	}
+	return nil
+}
+
+// isCBSSuccess reports whether a $cbs put-token reply status code
+// indicates success. IoT Hub's CBS node replies with any 2xx status
+// (200 in the common case, 202 if the request was accepted but not
+// yet fully applied), not just 202.
+func isCBSSuccess(code int32) bool {
+	return code >= 200 && code < 300
+}
@@ -0,0 +1,22 @@
+package amqp
+
+import "testing"
+
+func TestIsCBSSuccess(t *testing.T) {
+	cases := []struct {
+		code int32
+		want bool
+	}{
+		{200, true},
+		{202, true},
+		{299, true},
+		{0, false},
+		{300, false},
+		{401, false},
+	}
+	for _, c := range cases {
+		if got := isCBSSuccess(c.code); got != c.want {
+			t.Errorf("isCBSSuccess(%d) = %v, want %v", c.code, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package amqp
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/go-amqp"
+)
+
+// dispatchMethods receives direct method invocations off the methods
+// link and forwards them to the registered transport.MethodDispatcher,
+// publishing its response on the methods reply link.
+func (tr *Transport) dispatchMethods() {
+	ctx := context.Background()
+	for {
+		m, err := tr.methodReceiver.Receive(ctx, nil)
+		if err != nil {
+			return
+		}
+
+		name, _ := m.ApplicationProperties["method-name"].(string)
+		rid, _ := m.ApplicationProperties["request-id"].(string)
+		var payload []byte
+		if len(m.Data) > 0 {
+			payload = m.Data[0]
+		}
+		tr.methodReceiver.AcceptMessage(ctx, m)
+
+		tr.methodMu.Lock()
+		dispatch := tr.dispatch
+		tr.methodMu.Unlock()
+		if dispatch == nil {
+			continue
+		}
+
+		go func() {
+			resp, status := dispatch(ctx, name, payload)
+			reply := &amqp.Message{
+				ApplicationProperties: map[string]interface{}{
+					"status":     status,
+					"request-id": rid,
+				},
+				Data: [][]byte{resp},
+			}
+			if err := tr.methodSender.Send(ctx, reply, nil); err != nil {
+				tr.logger.Errorf("amqp: send method response: %s", fmt.Errorf("%w", err))
+			}
+		}()
+	}
+}
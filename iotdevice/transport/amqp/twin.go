@@ -0,0 +1,102 @@
+package amqp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+type twinResponse struct {
+	payload []byte
+	status  int
+	err     error
+}
+
+// RetrieveTwinProperties fetches the current twin document by sending a
+// GET over the twin link and waiting for the correlated reply.
+func (tr *Transport) RetrieveTwinProperties(ctx context.Context) ([]byte, error) {
+	reply, err := tr.twinRoundTrip(ctx, "GET", "", nil)
+	if err != nil {
+		return nil, fmt.Errorf("amqp: retrieve twin properties: %w", err)
+	}
+	return reply, nil
+}
+
+// UpdateTwinProperties patches the reported properties and returns the
+// resulting twin version.
+func (tr *Transport) UpdateTwinProperties(ctx context.Context, payload []byte) (int, error) {
+	reply, err := tr.twinRoundTrip(ctx, "PATCH", "/properties/reported", payload)
+	if err != nil {
+		return 0, fmt.Errorf("amqp: update twin properties: %w", err)
+	}
+	var v struct {
+		Version int `json:"$version"`
+	}
+	if err := json.Unmarshal(reply, &v); err != nil {
+		return 0, fmt.Errorf("amqp: parse twin version: %w", err)
+	}
+	return v.Version, nil
+}
+
+func (tr *Transport) twinRoundTrip(ctx context.Context, method, resource string, payload []byte) ([]byte, error) {
+	corrID := fmt.Sprintf("%s-%d", method, time.Now().UnixNano())
+	ch := make(chan twinResponse, 1)
+	tr.twinCorr.Store(corrID, ch)
+	defer tr.twinCorr.Delete(corrID)
+
+	msg := &amqp.Message{
+		Properties: &amqp.MessageProperties{
+			CorrelationID: corrID,
+		},
+		ApplicationProperties: map[string]interface{}{
+			"operation": method,
+			"resource":  resource,
+		},
+	}
+	if payload != nil {
+		msg.Data = [][]byte{payload}
+	}
+	if err := tr.twinSender.Send(ctx, msg, nil); err != nil {
+		return nil, fmt.Errorf("send: %w", err)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case resp := <-ch:
+		if resp.err != nil {
+			return nil, resp.err
+		}
+		if resp.status >= 300 {
+			return nil, fmt.Errorf("twin request failed with status %d", resp.status)
+		}
+		return resp.payload, nil
+	}
+}
+
+// dispatchTwinResponses delivers twin replies to whichever goroutine is
+// waiting on the matching correlation id.
+func (tr *Transport) dispatchTwinResponses() {
+	ctx := context.Background()
+	for {
+		m, err := tr.twinReceiver.Receive(ctx, nil)
+		if err != nil {
+			return
+		}
+
+		corrID, _ := m.Properties.CorrelationID.(string)
+		status, _ := m.ApplicationProperties["status"].(int32)
+		var payload []byte
+		if len(m.Data) > 0 {
+			payload = m.Data[0]
+		}
+		tr.twinReceiver.AcceptMessage(ctx, m)
+
+		if v, ok := tr.twinCorr.Load(corrID); ok {
+			v.(chan twinResponse) <- twinResponse{payload: payload, status: int(status)}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Package transport defines the interface iotdevice.Client drives to
+// speak to IoT Hub, so the wire protocol (mqtt, amqp, http, ...) is a
+// pluggable implementation detail rather than baked into the client.
+package transport
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"time"
+
+	"github.com/goautomotive/iothub/common"
+)
+
+// Transport is implemented by each wire protocol iotdevice speaks to
+// IoT Hub with.
+type Transport interface {
+	Connect(ctx context.Context, creds Credentials) error
+	PublishEvent(ctx context.Context, msg *common.Message) error
+	SubscribeEvents(ctx context.Context, mc chan<- *common.Message) error
+	RetrieveTwinProperties(ctx context.Context) ([]byte, error)
+	UpdateTwinProperties(ctx context.Context, payload []byte) (int, error)
+	RegisterDirectMethods(ctx context.Context, mux MethodDispatcher) error
+	Close() error
+}
+
+// Credentials carries everything a Transport needs to authenticate
+// with IoT Hub: TLS material for x509 auth, and/or a function that
+// mints a fresh SAS token for transports (such as AMQP's CBS
+// exchange) that need one.
+type Credentials struct {
+	DeviceID string
+	Hostname string
+	TLS      *tls.Config
+
+	// TokenFunc mints a SAS token for the given audience, valid for
+	// ttl. It is nil when the transport authenticates purely via TLS
+	// client certificates.
+	TokenFunc func(ctx context.Context, audience string, ttl time.Duration) (string, error)
+}
+
+// MethodDispatcher handles an incoming direct method call and returns
+// the JSON response payload plus a status code.
+type MethodDispatcher func(ctx context.Context, name string, payload []byte) (response []byte, status int)
+
+// ErrDisconnected should be wrapped by Transport implementations when
+// an operation fails because the connection to IoT Hub is currently
+// down, so callers such as the outbox can distinguish "retry later"
+// from a permanent error.
+var ErrDisconnected = errors.New("transport: disconnected")
@@ -0,0 +1,53 @@
+package iotdevice
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+
+	"github.com/goautomotive/iothub/iotdevice/crypto"
+)
+
+// WithX509FromURI is like WithX509FromFile but resolves the
+// certificate and private key through a registered crypto.Provider
+// instead of reading PEM files, e.g.
+// "pkcs11:token=device;object=device-key?module-path=/usr/lib/libsofthsm2.so".
+// The private key never leaves the provider; TLS signing is delegated
+// to it via crypto.Signer.
+//
+// certURI may be empty when keyURI's provider can also supply the
+// certificate (as the pkcs11 provider does when a matching
+// CKO_CERTIFICATE object exists on the token).
+func WithX509FromURI(deviceID, hostname, certURI, keyURI string) ClientOption {
+	return func(c *client) error {
+		u, err := url.Parse(keyURI)
+		if err != nil {
+			return fmt.Errorf("iotdevice: parse tls-key-uri: %w", err)
+		}
+
+		p, err := crypto.Lookup(u.Scheme)
+		if err != nil {
+			return err
+		}
+
+		signer, cert, err := p.Resolve(certURI, keyURI)
+		if err != nil {
+			return fmt.Errorf("iotdevice: resolve x509 credentials: %w", err)
+		}
+		if cert == nil {
+			return fmt.Errorf("iotdevice: tls-cert-uri is required, the %q provider did not return a certificate", u.Scheme)
+		}
+
+		c.deviceID = deviceID
+		c.hostname = hostname
+		c.tls = &tls.Config{
+			Certificates: []tls.Certificate{{
+				Certificate: [][]byte{cert.Raw},
+				PrivateKey:  signer,
+				Leaf:        cert,
+			}},
+			ServerName: hostname,
+		}
+		return nil
+	}
+}
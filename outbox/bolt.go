@@ -0,0 +1,135 @@
+package outbox
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var bucketName = []byte("outbox")
+
+// BoltStore is the default Store implementation, backed by a single
+// BoltDB file. Keys are the bucket's auto-incrementing sequence
+// number encoded big-endian, so iterating the bucket in key order
+// yields envelopes in the order they were enqueued.
+type BoltStore struct {
+	db          *bolt.DB
+	maxDiskSize int64 // bytes, 0 means unbounded
+}
+
+// Open creates or reopens a BoltDB-backed outbox at path. maxDiskSize
+// bounds the on-disk size of the outbox bucket; once exceeded,
+// Enqueue drops the oldest envelope(s) to make room (0 means
+// unbounded).
+func Open(path string, maxDiskSize int64) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(bucketName)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("outbox: create bucket: %w", err)
+	}
+	return &BoltStore{db: db, maxDiskSize: maxDiskSize}, nil
+}
+
+func (s *BoltStore) Enqueue(ctx context.Context, e Envelope) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("outbox: marshal envelope: %w", err)
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("outbox: next sequence: %w", err)
+		}
+		if err := bucket.Put(seqKey(seq), b); err != nil {
+			return fmt.Errorf("outbox: put: %w", err)
+		}
+
+		return s.evictOldestLocked(bucket)
+	})
+}
+
+// evictOldestLocked drops the oldest envelopes until the bucket fits
+// within maxDiskSize, or there is nothing left to drop. Called from
+// inside an update transaction.
+func (s *BoltStore) evictOldestLocked(bucket *bolt.Bucket) error {
+	if s.maxDiskSize <= 0 {
+		return nil
+	}
+	for bucketByteSize(bucket) > s.maxDiskSize {
+		c := bucket.Cursor()
+		k, _ := c.First()
+		if k == nil {
+			return nil
+		}
+		if err := bucket.Delete(k); err != nil {
+			return fmt.Errorf("outbox: evict oldest: %w", err)
+		}
+	}
+	return nil
+}
+
+func bucketByteSize(bucket *bolt.Bucket) int64 {
+	var size int64
+	_ = bucket.ForEach(func(k, v []byte) error {
+		size += int64(len(k) + len(v))
+		return nil
+	})
+	return size
+}
+
+func (s *BoltStore) Peek(ctx context.Context) (Envelope, error) {
+	var e Envelope
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucketName).Cursor()
+		k, v := c.First()
+		if k == nil {
+			return ErrEmpty
+		}
+		return json.Unmarshal(v, &e)
+	})
+	return e, err
+}
+
+func (s *BoltStore) Ack(ctx context.Context) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(bucketName)
+		c := bucket.Cursor()
+		k, _ := c.First()
+		if k == nil {
+			return ErrEmpty
+		}
+		return bucket.Delete(k)
+	})
+}
+
+func (s *BoltStore) Len(ctx context.Context) (int, error) {
+	var n int
+	err := s.db.View(func(tx *bolt.Tx) error {
+		n = tx.Bucket(bucketName).Stats().KeyN
+		return nil
+	})
+	return n, err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+func seqKey(seq uint64) []byte {
+	k := make([]byte, 8)
+	binary.BigEndian.PutUint64(k, seq)
+	return k
+}
@@ -0,0 +1,58 @@
+// Package outbox implements store-and-forward for D2C messages so a
+// device survives intermittent connectivity without losing telemetry:
+// iotdevice.WithOutboxStore queues a message here when the transport
+// reports disconnection and a background worker drains the queue,
+// in order, once the connection comes back.
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrEmpty is returned by Store.Peek and Store.Ack when the outbox has
+// nothing waiting to be sent.
+var ErrEmpty = errors.New("outbox: empty")
+
+// Envelope is a single queued D2C message.
+type Envelope struct {
+	Payload       []byte
+	Properties    map[string]string
+	MessageID     string
+	CorrelationID string
+
+	EnqueuedAt time.Time
+	TTL        time.Duration // zero means no expiry
+}
+
+// Expired reports whether e should be dropped instead of sent,
+// relative to now.
+func (e Envelope) Expired(now time.Time) bool {
+	return e.TTL > 0 && now.After(e.EnqueuedAt.Add(e.TTL))
+}
+
+// Store is the persistence interface WithOutboxStore depends on. The
+// default implementation is BoltDB-backed (see Open); BadgerDB, SQLite
+// or any other backend can be plugged in by implementing Store.
+type Store interface {
+	// Enqueue appends e to the tail of the queue, dropping the oldest
+	// queued envelope first if doing so is necessary to respect a
+	// configured max disk size.
+	Enqueue(ctx context.Context, e Envelope) error
+
+	// Peek returns the oldest queued envelope without removing it, so
+	// the caller can retry the same envelope after a failed send.
+	// It returns ErrEmpty if the queue is empty.
+	Peek(ctx context.Context) (Envelope, error)
+
+	// Ack removes the oldest queued envelope, previously returned by
+	// Peek, after it has been sent successfully.
+	Ack(ctx context.Context) error
+
+	// Len reports how many envelopes are currently queued.
+	Len(ctx context.Context) (int, error)
+
+	// Close releases any resources held by the store.
+	Close() error
+}